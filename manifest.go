@@ -0,0 +1,243 @@
+package s3update
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mitchellh/ioprogress"
+)
+
+// manifest is the structured, multi-channel alternative to a plain
+// S3VersionKey/S3ReleaseKey pair. Example:
+//
+//	{"channels":{"stable":{"version":42,"artifacts":{"linux/amd64":{"key":"...","sha256":"...","size":123,"minUpgradeFrom":40}},"rolloutPercent":25}}}
+type manifest struct {
+	Channels map[string]manifestChannel `json:"channels"`
+}
+
+type manifestChannel struct {
+	Version   int64                       `json:"version"`
+	Artifacts map[string]manifestArtifact `json:"artifacts"`
+	// RolloutPercent is a pointer so a manifest that omits it (the common
+	// case for a release with no staged rollout) defaults to a full
+	// rollout instead of silently blocking every client. An explicit 0
+	// still means "roll out to nobody yet".
+	RolloutPercent *int `json:"rolloutPercent"`
+}
+
+type manifestArtifact struct {
+	Key            string `json:"key"`
+	SHA256         string `json:"sha256"`
+	Size           int64  `json:"size"`
+	MinUpgradeFrom int64  `json:"minUpgradeFrom"`
+}
+
+// fetchManifest downloads and parses the JSON manifest at key.
+func fetchManifest(source ObjectSource, key string) (*manifest, error) {
+	data, err := readAll(source, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("s3update: invalid manifest at %s: %s", key, err.Error())
+	}
+
+	return &m, nil
+}
+
+// rolloutEligible reports whether machineID falls within the first
+// rolloutPercent% of the client population, by hashing machineID to a
+// stable bucket in [0, 100). A nil rolloutPercent (absent from the
+// manifest) means a full rollout.
+func rolloutEligible(machineID string, rolloutPercent *int) bool {
+	if rolloutPercent == nil || *rolloutPercent >= 100 {
+		return true
+	}
+
+	if *rolloutPercent <= 0 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(machineID))
+	bucket := binary.BigEndian.Uint32(sum[:4]) % 100
+
+	return int(bucket) < *rolloutPercent
+}
+
+// runManifestUpdate is the S3ManifestKey counterpart to runAutoUpdate's
+// plain S3VersionKey/S3ReleaseKey flow: it resolves the current channel's
+// version and per-platform artifact from the manifest, honors
+// minUpgradeFrom and rolloutPercent gating, then downloads and installs the
+// artifact the same way runAutoUpdate does.
+func runManifestUpdate(u Updater) error {
+	localVersion, err := strconv.ParseInt(u.CurrentVersion, 10, 64)
+	if err != nil || localVersion == 0 {
+		return fmt.Errorf("invalid local version")
+	}
+
+	svc := s3.New(newSession(u))
+	source := u.Source
+	if source == nil {
+		source = newS3Source(svc, u.S3Bucket, u.PinnedVersionID)
+	}
+	dlSource := newDownloadSource(svc, source, u)
+
+	m, err := fetchManifest(source, u.S3ManifestKey)
+	if err != nil {
+		return err
+	}
+
+	channel := u.Channel
+	if channel == "" {
+		channel = "stable"
+	}
+
+	ch, ok := m.Channels[channel]
+	if !ok {
+		return fmt.Errorf("s3update: no %q channel in manifest %s", channel, u.S3ManifestKey)
+	}
+
+	fmt.Printf("s3update: Local Version %d - Remote Version: %d (channel %q)\n", localVersion, ch.Version, channel)
+	if localVersion >= ch.Version {
+		return nil
+	}
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	artifact, ok := ch.Artifacts[platform]
+	if !ok {
+		return fmt.Errorf("s3update: no %q artifact in channel %q", platform, channel)
+	}
+
+	if artifact.MinUpgradeFrom > 0 && localVersion < artifact.MinUpgradeFrom {
+		return fmt.Errorf("s3update: local version %d must first upgrade to at least %d before reaching %d", localVersion, artifact.MinUpgradeFrom, ch.Version)
+	}
+
+	machineID := u.MachineID
+	if machineID == "" {
+		if machineID, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+
+	if !rolloutEligible(machineID, ch.RolloutPercent) {
+		fmt.Printf("s3update: version %d not yet rolled out to this client\n", ch.Version)
+		return nil
+	}
+
+	fmt.Printf("s3update: version outdated ... \n")
+
+	dest, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	destBackup := dest + ".bak"
+
+	body, size, err := dlSource.Get(artifact.Key)
+	if err != nil {
+		return err
+	}
+	remoteFileSize = size
+	progressR := &ioprogress.Reader{
+		Reader:       body,
+		Size:         size,
+		DrawInterval: 500 * time.Millisecond,
+		DrawFunc: ioprogress.DrawTerminalf(os.Stdout, func(progress, total int64) string {
+			bar := ioprogress.DrawTextFormatBar(40)
+			return fmt.Sprintf("%s %20s", bar(progress, total), ioprogress.DrawTextFormatBytes(progress, total))
+		}),
+	}
+
+	tempFile, err := ioutil.TempFile("", "s3update_tmp_download")
+	if err != nil {
+		return err
+	}
+	tempFilePath := tempFile.Name()
+
+	f, err := os.OpenFile(tempFile.Name(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, progressR); err != nil {
+		return err
+	}
+
+	if err := body.Close(); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := verifyManifestArtifact(tempFilePath, artifact.SHA256); err != nil {
+		_ = os.Remove(tempFilePath)
+		return err
+	}
+
+	// artifact.SHA256 only guards against a corrupted or swapped artifact
+	// within the manifest itself - it's published by the same bucket an
+	// attacker who can write to it also controls. PublicKey/S3SignatureKey
+	// (or S3ChecksumKey) is the actual trust boundary, checked by
+	// verifyDownload, and it gates manifest-mode installs the same way it
+	// gates runAutoUpdate's.
+	if err := verifyDownload(dlSource, u, artifact.Key, tempFilePath); err != nil {
+		_ = os.Remove(tempFilePath)
+		return err
+	}
+
+	if err := finalizeUpdate(dest, destBackup, tempFilePath); err != nil {
+		return err
+	}
+
+	fmt.Printf("s3update: updated with success to version %d\nRestarting application\n", ch.Version)
+
+	if err := syscall.Exec(dest, os.Args, os.Environ()); err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
+
+// verifyManifestArtifact checks tempFilePath's SHA256 against expectedHex,
+// the checksum published in the manifest artifact entry. A blank
+// expectedHex skips verification.
+func verifyManifestArtifact(tempFilePath, expectedHex string) error {
+	if expectedHex == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(tempFilePath)
+	if err != nil {
+		return err
+	}
+
+	got := sha256.Sum256(data)
+	if !strings.EqualFold(expectedHex, hex.EncodeToString(got[:])) {
+		return fmt.Errorf("s3update: manifest artifact checksum mismatch for %s", tempFilePath)
+	}
+
+	return nil
+}
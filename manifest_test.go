@@ -0,0 +1,57 @@
+package s3update
+
+import (
+	"fmt"
+	"testing"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestRolloutEligible_NilMeansFullRollout(t *testing.T) {
+	if !rolloutEligible("any-machine", nil) {
+		t.Fatal("expected an absent rolloutPercent to mean a full rollout")
+	}
+}
+
+func TestRolloutEligible_HundredAlwaysTrue(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		machineID := fmt.Sprintf("machine-%d", i)
+		if !rolloutEligible(machineID, intPtr(100)) {
+			t.Fatalf("expected rolloutPercent=100 to always be eligible, machine %q was not", machineID)
+		}
+	}
+}
+
+func TestRolloutEligible_ZeroAlwaysFalse(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		machineID := fmt.Sprintf("machine-%d", i)
+		if rolloutEligible(machineID, intPtr(0)) {
+			t.Fatalf("expected an explicit rolloutPercent=0 to never be eligible, machine %q was", machineID)
+		}
+	}
+}
+
+func TestRolloutEligible_DeterministicPerMachine(t *testing.T) {
+	percent := intPtr(50)
+	first := rolloutEligible("stable-machine-id", percent)
+	for i := 0; i < 10; i++ {
+		if rolloutEligible("stable-machine-id", percent) != first {
+			t.Fatal("expected the same machine ID to always get the same rollout decision")
+		}
+	}
+}
+
+func TestRolloutEligible_RoughlySplitsPopulation(t *testing.T) {
+	percent := intPtr(50)
+	eligible := 0
+	const total = 2000
+	for i := 0; i < total; i++ {
+		if rolloutEligible(fmt.Sprintf("machine-%d", i), percent) {
+			eligible++
+		}
+	}
+
+	if eligible < total*3/10 || eligible > total*7/10 {
+		t.Fatalf("expected roughly half of %d machines to be eligible at 50%%, got %d", total, eligible)
+	}
+}
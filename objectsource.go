@@ -0,0 +1,141 @@
+package s3update
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectSource abstracts the storage backend s3update downloads release
+// artifacts from. The default backend, used when Updater.Source is nil, is
+// AWS S3 via the existing svc client. Implementations should return
+// ErrObjectNotFound when key doesn't exist, so callers like tryPatchUpdate
+// can tell a missing object apart from a transport error.
+type ObjectSource interface {
+	// Get returns the contents of key and its size in bytes. The caller is
+	// responsible for closing the returned reader.
+	Get(key string) (io.ReadCloser, int64, error)
+}
+
+// ErrObjectNotFound is returned by an ObjectSource when the requested key
+// does not exist in the backend.
+var ErrObjectNotFound = errors.New("s3update: object not found")
+
+// s3Source is the default ObjectSource, backed by the AWS S3 SDK. It is
+// what runAutoUpdate used exclusively before Updater.Source existed.
+type s3Source struct {
+	svc       *s3.S3
+	bucket    string
+	versionID string
+}
+
+func newS3Source(svc *s3.S3, bucket, versionID string) *s3Source {
+	return &s3Source{svc: svc, bucket: bucket, versionID: versionID}
+}
+
+func (s *s3Source) Get(key string) (io.ReadCloser, int64, error) {
+	resp, err := s.svc.GetObject(getObjectInput(s.bucket, key, s.versionID))
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, 0, ErrObjectNotFound
+		}
+		return nil, 0, err
+	}
+
+	return resp.Body, aws.Int64Value(resp.ContentLength), nil
+}
+
+// NewS3CompatSource builds an ObjectSource for an S3-compatible endpoint
+// (MinIO, Ceph, Cloudflare R2, Backblaze B2's S3 gateway, ...) by pointing
+// the AWS SDK at a custom Endpoint and, where required, enabling
+// path-style addressing.
+func NewS3CompatSource(bucket, region, endpoint string, forcePathStyle bool) ObjectSource {
+	svc := s3.New(session.Must(session.NewSession()), &aws.Config{
+		Region:           aws.String(region),
+		Endpoint:         aws.String(endpoint),
+		S3ForcePathStyle: aws.Bool(forcePathStyle),
+	})
+
+	return newS3Source(svc, bucket, "")
+}
+
+// presignedSource is an ObjectSource that fetches each object through a
+// freshly generated, short-lived presigned URL over plain HTTPS instead of
+// an authenticated S3 API call. This is used when Updater.UsePresignedURL
+// is set, so the bulk of the release download doesn't require the AWS SDK
+// to hold privileged credentials for the whole transfer.
+type presignedSource struct {
+	svc       *s3.S3
+	bucket    string
+	versionID string
+	ttl       time.Duration
+}
+
+func (p *presignedSource) Get(key string) (io.ReadCloser, int64, error) {
+	req, _ := p.svc.GetObjectRequest(getObjectInput(p.bucket, key, p.versionID))
+	url, err := req.Presign(p.ttl)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, ErrObjectNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("s3update: presigned GET for %s: unexpected status %s", key, resp.Status)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// HTTPSource is an ObjectSource for releases served over plain HTTPS, e.g. a
+// bucket fronted by a CDN such as CloudFront or Cloudflare, with no AWS
+// credentials required client-side. Keys are joined to BaseURL to form the
+// request URL.
+type HTTPSource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewHTTPSource builds an HTTPSource serving objects from baseURL, using
+// http.DefaultClient.
+func NewHTTPSource(baseURL string) *HTTPSource {
+	return &HTTPSource{BaseURL: baseURL, Client: http.DefaultClient}
+}
+
+func (h *HTTPSource) Get(key string) (io.ReadCloser, int64, error) {
+	url := strings.TrimRight(h.BaseURL, "/") + "/" + strings.TrimLeft(key, "/")
+
+	resp, err := h.Client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, ErrObjectNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("s3update: GET %s: unexpected status %s", url, resp.Status)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
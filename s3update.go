@@ -1,6 +1,9 @@
 package s3update
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,8 +16,11 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gabstv/go-bsdiff/pkg/bspatch"
 	"github.com/mitchellh/ioprogress"
 )
 
@@ -34,6 +40,67 @@ type Updater struct {
 	S3ReleaseKey string
 	// S3VersionKey represents the key on S3 to download the current version
 	S3VersionKey string
+	// PublicKey, when set, is used to verify the ed25519 signature of the
+	// downloaded binary before it replaces the running executable. The
+	// signature itself is downloaded from S3SignatureKey.
+	PublicKey ed25519.PublicKey
+	// S3SignatureKey represents the S3 key of the detached signature for the
+	// release binary, e.g. `cli/releases/cli-{{OS}}-{{ARCH}}.sig`. Required
+	// when PublicKey is set.
+	S3SignatureKey string
+	// S3ChecksumKey represents the S3 key of a hex-encoded SHA256 checksum
+	// of the release binary, e.g. `cli/releases/cli-{{OS}}-{{ARCH}}.sha256`.
+	// This is an alternative to PublicKey/S3SignatureKey for users who
+	// prefer publishing checksums instead of signatures.
+	S3ChecksumKey string
+	// PinnedVersionID, when set, pins the S3VersionKey and S3ReleaseKey
+	// lookups to a specific S3 object version instead of the latest one.
+	// This requires versioning to be enabled on S3Bucket.
+	PinnedVersionID string
+	// PatchMode, when set, makes runAutoUpdate try to download and apply a
+	// bsdiff patch from S3PatchKeyTemplate instead of the full binary,
+	// falling back to a full download when no matching patch is published.
+	PatchMode bool
+	// S3PatchKeyTemplate represents the S3 key template for a bsdiff patch
+	// between two versions, e.g.
+	// `cli/patches/cli-{{OS}}-{{ARCH}}-{{FROM}}-to-{{TO}}.bsdiff`.
+	// Required when PatchMode is set.
+	S3PatchKeyTemplate string
+	// Source, when set, overrides the storage backend runAutoUpdate reads
+	// S3VersionKey/S3ReleaseKey (and the signature/checksum/patch keys
+	// derived from them) from. When nil, the default AWS S3 backend is
+	// used, preserving prior behavior. See NewS3CompatSource and
+	// HTTPSource for alternative backends.
+	Source ObjectSource
+	// Credentials, when set, overrides the default AWS credential provider
+	// chain used to authenticate S3 calls. Use this to scope the updater
+	// down to a narrow IAM user/role instead of relying on ambient
+	// environment credentials.
+	Credentials *credentials.Credentials
+	// AssumeRoleARN, when set, assumes this IAM role via STS before making
+	// any S3 calls, using Credentials (or the default chain) as the base
+	// credentials for the AssumeRole call.
+	AssumeRoleARN string
+	// UsePresignedURL, when set, downloads the release binary (and its
+	// signature/checksum/patch companions) via a short-lived presigned URL
+	// over plain HTTPS instead of an authenticated S3 API call. This lets
+	// clients carrying only scoped IAM credentials or a short-lived
+	// assumed role fetch releases from a private bucket without making the
+	// artifacts world-readable. Ignored when Source is set.
+	UsePresignedURL bool
+	// S3ManifestKey represents the S3 key of a JSON manifest document
+	// describing per-channel, per-platform release metadata (see
+	// manifest). When set, it takes precedence over S3VersionKey and
+	// S3ReleaseKey and enables channels, staged rollouts, and
+	// minUpgradeFrom gating.
+	S3ManifestKey string
+	// Channel selects which entry of the manifest's "channels" map to
+	// follow, e.g. "stable" or "beta". Defaults to "stable" when
+	// S3ManifestKey is set and Channel is empty.
+	Channel string
+	// MachineID identifies this client for the manifest's staged rollout
+	// gating (rolloutPercent). Defaults to os.Hostname() when empty.
+	MachineID string
 }
 
 // validate ensures every required fields is correctly set. Otherwise and error is returned.
@@ -50,12 +117,22 @@ func (u Updater) validate() error {
 		return fmt.Errorf("no s3 region")
 	}
 
-	if u.S3ReleaseKey == "" {
-		return fmt.Errorf("no s3ReleaseKey set")
+	if u.S3ManifestKey == "" {
+		if u.S3ReleaseKey == "" {
+			return fmt.Errorf("no s3ReleaseKey set")
+		}
+
+		if u.S3VersionKey == "" {
+			return fmt.Errorf("no s3VersionKey set")
+		}
 	}
 
-	if u.S3VersionKey == "" {
-		return fmt.Errorf("no s3VersionKey set")
+	if len(u.PublicKey) > 0 && u.S3SignatureKey == "" {
+		return fmt.Errorf("no s3SignatureKey set")
+	}
+
+	if u.PatchMode && u.S3PatchKeyTemplate == "" {
+		return fmt.Errorf("no s3PatchKeyTemplate set")
 	}
 
 	return nil
@@ -78,6 +155,161 @@ func AutoUpdate(u Updater) error {
 	return runAutoUpdate(u)
 }
 
+// presignTTL is how long a presigned release URL stays valid for.
+const presignTTL = 15 * time.Minute
+
+// newDownloadSource builds the ObjectSource used to fetch the release binary
+// and its signature/checksum/patch companions. With UsePresignedURL (and no
+// Source), these are fetched over presigned HTTPS URLs instead of
+// authenticated S3 API calls; the version/manifest lookup still goes through
+// source. Shared by runAutoUpdate
+// and runManifestUpdate so both modes apply the same download path.
+func newDownloadSource(svc *s3.S3, source ObjectSource, u Updater) ObjectSource {
+	if u.Source == nil && u.UsePresignedURL {
+		return &presignedSource{svc: svc, bucket: u.S3Bucket, versionID: u.PinnedVersionID, ttl: presignTTL}
+	}
+
+	return source
+}
+
+// newSession builds the AWS session used for every S3 call, honoring
+// Updater.Credentials and Updater.AssumeRoleARN when set.
+func newSession(u Updater) *session.Session {
+	cfg := &aws.Config{Region: aws.String(u.S3Region)}
+	if u.Credentials != nil {
+		cfg.Credentials = u.Credentials
+	}
+	sess := session.Must(session.NewSession(cfg))
+
+	if u.AssumeRoleARN == "" {
+		return sess
+	}
+
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(u.S3Region),
+		Credentials: stscreds.NewCredentials(sess, u.AssumeRoleARN),
+	}))
+}
+
+// getObjectInput builds a GetObjectInput for bucket/key, optionally pinned to
+// a specific S3 object VersionId when versionID is non-empty.
+func getObjectInput(bucket, key, versionID string) *s3.GetObjectInput {
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
+	return input
+}
+
+// previousVersionID resolves the S3 object VersionId to roll back to for
+// releaseKey. It first looks for a companion marker object at
+// versionKey+".prev" containing the VersionId to use, falling back to
+// ListObjectVersions on releaseKey and picking the version preceding the
+// current (latest) one.
+func previousVersionID(svc *s3.S3, bucket, versionKey, releaseKey string) (string, error) {
+	marker, err := fetchS3Object(svc, bucket, versionKey+".prev")
+	if err == nil {
+		return strings.TrimSpace(string(marker)), nil
+	}
+
+	out, err := svc.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String(bucket), Prefix: aws.String(releaseKey)})
+	if err != nil {
+		return "", err
+	}
+
+	// The prefix also matches companion keys such as releaseKey+".sig", so
+	// keep only releaseKey's own versions.
+	var versions []*s3.ObjectVersion
+	for _, v := range out.Versions {
+		if aws.StringValue(v.Key) == releaseKey {
+			versions = append(versions, v)
+		}
+	}
+
+	if len(versions) < 2 {
+		return "", fmt.Errorf("s3update: no previous version found for %s", releaseKey)
+	}
+
+	// ListObjectVersions returns versions most-recent-first, so index 1 is
+	// the one preceding the current release.
+	return aws.StringValue(versions[1].VersionId), nil
+}
+
+// Rollback downgrades the running binary to the version preceding the
+// current release, as resolved by previousVersionID, reusing the same
+// atomic rename/backup flow as runAutoUpdate.
+func Rollback(u Updater) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+
+	svc := s3.New(newSession(u))
+	s3Key := generateS3ReleaseKey(u.S3ReleaseKey)
+
+	versionID, err := previousVersionID(svc, u.S3Bucket, u.S3VersionKey, s3Key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("s3update: rolling back %s to version id %s\n", s3Key, versionID)
+	resp, err := svc.GetObject(getObjectInput(u.S3Bucket, s3Key, versionID))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dest, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	destBackup := dest + ".bak"
+
+	tempFile, err := ioutil.TempFile("", "s3update_tmp_rollback")
+	if err != nil {
+		return err
+	}
+	tempFilePath := tempFile.Name()
+
+	f, err := os.OpenFile(tempFile.Name(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	remoteFileSize = *resp.ContentLength
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := verifyDownload(newS3Source(svc, u.S3Bucket, versionID), u, s3Key, tempFilePath); err != nil {
+		_ = os.Remove(tempFilePath)
+		return err
+	}
+
+	if err := finalizeUpdate(dest, destBackup, tempFilePath); err != nil {
+		return err
+	}
+
+	fmt.Printf("s3update: rolled back with success to version id %s\nRestarting application\n", versionID)
+	if err := syscall.Exec(dest, os.Args, os.Environ()); err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
+
 // generateS3ReleaseKey dynamically builds the S3 key depending on the os and architecture.
 func generateS3ReleaseKey(path string) string {
 	path = strings.Replace(path, "{{OS}}", runtime.GOOS, -1)
@@ -86,19 +318,110 @@ func generateS3ReleaseKey(path string) string {
 	return path
 }
 
+// generateS3PatchKey dynamically builds the S3 key of the bsdiff patch
+// between fromVersion and toVersion, in addition to the os/arch
+// substitution done by generateS3ReleaseKey.
+func generateS3PatchKey(template string, fromVersion, toVersion int64) string {
+	path := generateS3ReleaseKey(template)
+	path = strings.Replace(path, "{{FROM}}", strconv.FormatInt(fromVersion, 10), -1)
+	path = strings.Replace(path, "{{TO}}", strconv.FormatInt(toVersion, 10), -1)
+
+	return path
+}
+
+// tryPatchUpdate attempts to build the new binary by downloading and
+// applying a bsdiff patch against the currently running executable,
+// instead of downloading the full release. It reports ok == false,
+// with no error, whenever a full download should be used instead: the
+// patch object is missing, the patch cannot be applied, or the patched
+// result doesn't match the published checksum.
+func tryPatchUpdate(source ObjectSource, u Updater, localVersion, remoteVersion int64, s3ReleaseKey string) (tempFilePath string, ok bool, err error) {
+	if !u.PatchMode {
+		return "", false, nil
+	}
+
+	patchKey := generateS3PatchKey(u.S3PatchKeyTemplate, localVersion, remoteVersion)
+	patch, err := readAll(source, patchKey)
+	if err != nil {
+		if err == ErrObjectNotFound {
+			fmt.Printf("s3update: no patch found at %s, falling back to full download\n", patchKey)
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	dest, err := os.Executable()
+	if err != nil {
+		return "", false, err
+	}
+
+	current, err := ioutil.ReadFile(dest)
+	if err != nil {
+		return "", false, err
+	}
+
+	patched, err := bspatch.Bytes(current, patch)
+	if err != nil {
+		fmt.Printf("s3update: failed to apply patch %s: %s - falling back to full download\n", patchKey, err.Error())
+		return "", false, nil
+	}
+
+	expected, err := readAll(source, s3ReleaseKey+".sha256")
+	if err != nil {
+		return "", false, err
+	}
+
+	got := sha256.Sum256(patched)
+	if !strings.EqualFold(strings.TrimSpace(string(expected)), hex.EncodeToString(got[:])) {
+		fmt.Printf("s3update: patched binary checksum mismatch - falling back to full download\n")
+		return "", false, nil
+	}
+
+	tempFile, err := ioutil.TempFile("", "s3update_tmp_patch")
+	if err != nil {
+		return "", false, err
+	}
+	tempFilePath = tempFile.Name()
+
+	if err := tempFile.Close(); err != nil {
+		return "", false, err
+	}
+
+	if err := ioutil.WriteFile(tempFilePath, patched, 0755); err != nil {
+		_ = os.Remove(tempFilePath)
+		return "", false, err
+	}
+
+	remoteFileSize = int64(len(patched))
+
+	return tempFilePath, true, nil
+}
+
 func runAutoUpdate(u Updater) error {
+	if u.S3ManifestKey != "" {
+		return runManifestUpdate(u)
+	}
+
 	localVersion, err := strconv.ParseInt(u.CurrentVersion, 10, 64)
 	if err != nil || localVersion == 0 {
 		return fmt.Errorf("invalid local version")
 	}
 
-	svc := s3.New(session.Must(session.NewSession()), &aws.Config{Region: aws.String(u.S3Region)})
-	resp, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(u.S3Bucket), Key: aws.String(u.S3VersionKey)})
+	svc := s3.New(newSession(u))
+	source := u.Source
+	if source == nil {
+		source = newS3Source(svc, u.S3Bucket, u.PinnedVersionID)
+	}
+
+	dlSource := newDownloadSource(svc, source, u)
+
+	versionBody, _, err := source.Get(u.S3VersionKey)
 	if err != nil {
 		return err
 	}
+	defer versionBody.Close()
 
-	b, err := ioutil.ReadAll(resp.Body)
+	b, err := ioutil.ReadAll(versionBody)
 	if err != nil {
 		return err
 	}
@@ -112,20 +435,6 @@ func runAutoUpdate(u Updater) error {
 	if localVersion < remoteVersion {
 		fmt.Printf("s3update: version outdated ... \n")
 		s3Key := generateS3ReleaseKey(u.S3ReleaseKey)
-		resp, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(u.S3Bucket), Key: aws.String(s3Key)})
-		if err != nil {
-			return err
-		}
-		remoteFileSize = *resp.ContentLength
-		progressR := &ioprogress.Reader{
-			Reader:       resp.Body,
-			Size:         *resp.ContentLength,
-			DrawInterval: 500 * time.Millisecond,
-			DrawFunc: ioprogress.DrawTerminalf(os.Stdout, func(progress, total int64) string {
-				bar := ioprogress.DrawTextFormatBar(40)
-				return fmt.Sprintf("%s %20s", bar(progress, total), ioprogress.DrawTextFormatBytes(progress, total))
-			}),
-		}
 
 		dest, err := os.Executable()
 		if err != nil {
@@ -134,36 +443,67 @@ func runAutoUpdate(u Updater) error {
 
 		destBackup := dest + ".bak"
 
-		// Create a temp file
-		tempFile, err := ioutil.TempFile("", "s3update_tmp_download")
+		tempFilePath, patched, err := tryPatchUpdate(dlSource, u, localVersion, remoteVersion, s3Key)
 		if err != nil {
 			return err
 		}
-		tempFilePath := tempFile.Name()
 
-		// Download to tempFile
-		// Use the same flags that ioutil.WriteFile uses
-		f, err := os.OpenFile(tempFile.Name(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
-		if err != nil {
-			_ = os.Remove(tempFile.Name())
-			return err
-		}
-
-		if err := tempFile.Close(); err != nil {
-			return err
+		if !patched {
+			body, size, err := dlSource.Get(s3Key)
+			if err != nil {
+				return err
+			}
+			remoteFileSize = size
+			progressR := &ioprogress.Reader{
+				Reader:       body,
+				Size:         size,
+				DrawInterval: 500 * time.Millisecond,
+				DrawFunc: ioprogress.DrawTerminalf(os.Stdout, func(progress, total int64) string {
+					bar := ioprogress.DrawTextFormatBar(40)
+					return fmt.Sprintf("%s %20s", bar(progress, total), ioprogress.DrawTextFormatBytes(progress, total))
+				}),
+			}
+
+			// Create a temp file
+			tempFile, err := ioutil.TempFile("", "s3update_tmp_download")
+			if err != nil {
+				return err
+			}
+			tempFilePath = tempFile.Name()
+
+			// Download to tempFile
+			// Use the same flags that ioutil.WriteFile uses
+			f, err := os.OpenFile(tempFile.Name(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+			if err != nil {
+				_ = os.Remove(tempFile.Name())
+				return err
+			}
+
+			if err := tempFile.Close(); err != nil {
+				return err
+			}
+
+			if _, err := io.Copy(f, progressR); err != nil {
+				return err
+			}
+
+			// Close the response stream
+			if err := body.Close(); err != nil {
+				return err
+			}
+
+			// The file must be closed so we can execute it in the next step
+			if err := f.Close(); err != nil {
+				return err
+			}
 		}
 
-		if _, err := io.Copy(f, progressR); err != nil {
-			return err
-		}
-
-		// Close the response stream
-		if err := resp.Body.Close(); err != nil {
-			return err
-		}
-
-		// The file must be closed so we can execute it in the next step
-		if err := f.Close(); err != nil {
+		// Run even on the patched path: tryPatchUpdate only compares
+		// against an unsigned checksum object, which is no stronger than
+		// the patch's own provenance. PublicKey/S3ChecksumKey must gate
+		// every binary that reaches finalizeUpdate, patched or not.
+		if err := verifyDownload(dlSource, u, s3Key, tempFilePath); err != nil {
+			_ = os.Remove(tempFilePath)
 			return err
 		}
 
@@ -184,6 +524,72 @@ func runAutoUpdate(u Updater) error {
 	return nil
 }
 
+// verifyDownload authenticates the downloaded release at tempFilePath before
+// it is allowed to replace the running executable. It prefers signature
+// verification (PublicKey/S3SignatureKey) over a plain checksum
+// (S3ChecksumKey) when both are configured, and is a no-op if neither is set.
+func verifyDownload(source ObjectSource, u Updater, releaseKey, tempFilePath string) error {
+	if len(u.PublicKey) == 0 && u.S3ChecksumKey == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(tempFilePath)
+	if err != nil {
+		return err
+	}
+
+	if len(u.PublicKey) > 0 {
+		sigKey := generateS3ReleaseKey(u.S3SignatureKey)
+		sig, err := readAll(source, sigKey)
+		if err != nil {
+			return err
+		}
+
+		if !ed25519.Verify(u.PublicKey, data, sig) {
+			return fmt.Errorf("s3update: signature verification failed for %s", releaseKey)
+		}
+
+		return nil
+	}
+
+	checksumKey := generateS3ReleaseKey(u.S3ChecksumKey)
+	want, err := readAll(source, checksumKey)
+	if err != nil {
+		return err
+	}
+
+	got := sha256.Sum256(data)
+	if !strings.EqualFold(strings.TrimSpace(string(want)), hex.EncodeToString(got[:])) {
+		return fmt.Errorf("s3update: checksum verification failed for %s", releaseKey)
+	}
+
+	return nil
+}
+
+// readAll fetches key from source and returns its full contents.
+func readAll(source ObjectSource, key string) ([]byte, error) {
+	body, _, err := source.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return ioutil.ReadAll(body)
+}
+
+// fetchS3Object downloads and returns the full contents of an S3 object.
+// Unlike readAll, this always talks to AWS S3 directly and is used by code
+// that is inherently S3-specific, such as Rollback's version lookups.
+func fetchS3Object(svc *s3.S3, bucket, key string) ([]byte, error) {
+	resp, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
 func finalizeUpdate(originalFilePath, backupFilePath, tempFilePath string) (err error) {
 	if downloadSucceeded(tempFilePath) {
 		// Backup current binary
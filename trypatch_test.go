@@ -0,0 +1,116 @@
+package s3update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gabstv/go-bsdiff/pkg/bsdiff"
+)
+
+func TestTryPatchUpdate_DisabledIsNoop(t *testing.T) {
+	u := Updater{PatchMode: false}
+
+	tempFilePath, ok, err := tryPatchUpdate(fakeObjectSource{}, u, 1, 2, "cli/release")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if ok {
+		t.Fatal("expected PatchMode=false to never attempt a patch")
+	}
+	if tempFilePath != "" {
+		t.Fatalf("expected no temp file, got %q", tempFilePath)
+	}
+}
+
+func TestTryPatchUpdate_MissingPatchFallsBack(t *testing.T) {
+	u := Updater{PatchMode: true, S3PatchKeyTemplate: "cli/patches/1-to-2.bsdiff"}
+
+	tempFilePath, ok, err := tryPatchUpdate(fakeObjectSource{}, u, 1, 2, "cli/release")
+	if err != nil {
+		t.Fatalf("expected a missing patch to fall back without error, got %s", err)
+	}
+	if ok {
+		t.Fatal("expected a missing patch object to fall back to a full download")
+	}
+	if tempFilePath != "" {
+		t.Fatalf("expected no temp file, got %q", tempFilePath)
+	}
+}
+
+func TestTryPatchUpdate_ChecksumMismatchFallsBack(t *testing.T) {
+	dest, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable: %s", err)
+	}
+	current, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	newContent := append(append([]byte{}, current...), []byte("-patched")...)
+	patch, err := bsdiff.Bytes(current, newContent)
+	if err != nil {
+		t.Fatalf("bsdiff.Bytes: %s", err)
+	}
+
+	u := Updater{PatchMode: true, S3PatchKeyTemplate: "patch"}
+	source := fakeObjectSource{
+		"patch":              patch,
+		"cli/release.sha256": []byte(hex.EncodeToString(make([]byte, sha256.Size))),
+	}
+
+	tempFilePath, ok, err := tryPatchUpdate(source, u, 1, 2, "cli/release")
+	if err != nil {
+		t.Fatalf("expected a checksum mismatch to fall back without error, got %s", err)
+	}
+	if ok {
+		t.Fatal("expected a patched binary with the wrong checksum to fall back to a full download")
+	}
+	if tempFilePath != "" {
+		t.Fatalf("expected no temp file, got %q", tempFilePath)
+	}
+}
+
+func TestTryPatchUpdate_Success(t *testing.T) {
+	dest, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable: %s", err)
+	}
+	current, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	newContent := append(append([]byte{}, current...), []byte("-patched")...)
+	patch, err := bsdiff.Bytes(current, newContent)
+	if err != nil {
+		t.Fatalf("bsdiff.Bytes: %s", err)
+	}
+	sum := sha256.Sum256(newContent)
+
+	u := Updater{PatchMode: true, S3PatchKeyTemplate: "patch"}
+	source := fakeObjectSource{
+		"patch":              patch,
+		"cli/release.sha256": []byte(hex.EncodeToString(sum[:])),
+	}
+
+	tempFilePath, ok, err := tryPatchUpdate(source, u, 1, 2, "cli/release")
+	if err != nil {
+		t.Fatalf("expected patch application to succeed, got %s", err)
+	}
+	if !ok {
+		t.Fatal("expected a valid patch plus matching checksum to succeed")
+	}
+	defer os.Remove(tempFilePath)
+
+	got, err := ioutil.ReadFile(tempFilePath)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if string(got) != string(newContent) {
+		t.Fatal("expected the patched temp file to match the reconstructed content")
+	}
+}
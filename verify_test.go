@@ -0,0 +1,107 @@
+package s3update
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// fakeObjectSource serves canned bytes for Get, keyed by name, used to
+// exercise verifyDownload without any AWS dependency.
+type fakeObjectSource map[string][]byte
+
+func (f fakeObjectSource) Get(key string) (io.ReadCloser, int64, error) {
+	data, ok := f[key]
+	if !ok {
+		return nil, 0, ErrObjectNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func writeTempFile(t *testing.T, data []byte) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "s3update_verify_test")
+	if err != nil {
+		t.Fatalf("TempFile: %s", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	return f.Name()
+}
+
+func TestVerifyDownload_NoopWhenUnconfigured(t *testing.T) {
+	path := writeTempFile(t, []byte("release bytes"))
+	u := Updater{S3ReleaseKey: "cli/release"}
+
+	if err := verifyDownload(fakeObjectSource{}, u, "cli/release", path); err != nil {
+		t.Fatalf("expected no-op verification to succeed, got %s", err)
+	}
+}
+
+func TestVerifyDownload_SignatureValid(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+
+	data := []byte("release bytes")
+	path := writeTempFile(t, data)
+	sig := ed25519.Sign(priv, data)
+
+	u := Updater{PublicKey: pub, S3SignatureKey: "cli/release.sig"}
+	source := fakeObjectSource{"cli/release.sig": sig}
+
+	if err := verifyDownload(source, u, "cli/release", path); err != nil {
+		t.Fatalf("expected valid signature to verify, got %s", err)
+	}
+}
+
+func TestVerifyDownload_SignatureInvalid(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+
+	path := writeTempFile(t, []byte("release bytes"))
+
+	u := Updater{PublicKey: pub, S3SignatureKey: "cli/release.sig"}
+	source := fakeObjectSource{"cli/release.sig": []byte("not a real signature")}
+
+	if err := verifyDownload(source, u, "cli/release", path); err == nil {
+		t.Fatal("expected an invalid signature to fail verification")
+	}
+}
+
+func TestVerifyDownload_ChecksumValid(t *testing.T) {
+	data := []byte("release bytes")
+	path := writeTempFile(t, data)
+	sum := sha256.Sum256(data)
+
+	u := Updater{S3ChecksumKey: "cli/release.sha256"}
+	source := fakeObjectSource{"cli/release.sha256": []byte(hex.EncodeToString(sum[:]))}
+
+	if err := verifyDownload(source, u, "cli/release", path); err != nil {
+		t.Fatalf("expected matching checksum to verify, got %s", err)
+	}
+}
+
+func TestVerifyDownload_ChecksumMismatch(t *testing.T) {
+	path := writeTempFile(t, []byte("release bytes"))
+
+	u := Updater{S3ChecksumKey: "cli/release.sha256"}
+	source := fakeObjectSource{"cli/release.sha256": []byte(hex.EncodeToString(make([]byte, sha256.Size)))}
+
+	if err := verifyDownload(source, u, "cli/release", path); err == nil {
+		t.Fatal("expected a mismatched checksum to fail verification")
+	}
+}